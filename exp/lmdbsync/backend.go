@@ -0,0 +1,134 @@
+package lmdbsync
+
+import (
+	"os"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// TxnOp is a unit of work run by Env inside a transaction.  Unlike
+// lmdb.TxnOp, whose signature is tied to *lmdb.Txn, a TxnOp receives its
+// Backend's transaction handle as txn, typed according to whichever engine
+// the Env was constructed with: *lmdb.Txn for the Backend built by NewEnv,
+// *mdbx.Txn for one built by NewMDBXBackend.  Callers write ops against
+// whichever backend they configured their Env with and type-assert txn to
+// the corresponding concrete type; a TxnOp written for one backend will
+// panic if run against another.
+type TxnOp func(txn interface{}) error
+
+// Backend is the set of environment operations an Env needs from its
+// underlying storage engine.  Env performs all of its MapResized retrying,
+// NoLock gating, and handler-chain dispatch against a Backend, so any type
+// implementing Backend can be used in place of the stock *lmdb.Env wrapper,
+// provided it exposes lmdb-compatible flags, errno values, and TxnOp
+// semantics.
+//
+// lmdb-go itself is wrapped by the unexported lmdbBackend type, constructed
+// by NewEnv.  Other LMDB-workalike engines, such as mdbx-go, can be wrapped
+// similarly and passed to NewEnvWithBackend.
+type Backend interface {
+	// Open opens the environment at path, analogous to lmdb.Env.Open.
+	Open(path string, flags uint, mode os.FileMode) error
+
+	// SetFlags and UnsetFlags adjust the environment's flags after Open,
+	// analogous to the identically named lmdb.Env methods.
+	SetFlags(flags uint) error
+	UnsetFlags(flags uint) error
+
+	// Flags returns the flags currently set on the environment.
+	Flags() (uint, error)
+
+	// SetMapSize sets the size of the environment's memory map, analogous
+	// to lmdb.Env.SetMapSize.  Callers, including Env itself, are
+	// responsible for ensuring no transactions are in progress.
+	SetMapSize(size int64) error
+
+	// RunTxn, View, Update, and UpdateLocked run a transaction, analogous
+	// to the identically named lmdb.Env methods.  Each implementation
+	// invokes op with its own concrete transaction type.
+	RunTxn(flags uint, op TxnOp) error
+	View(op TxnOp) error
+	Update(op TxnOp) error
+	UpdateLocked(op TxnOp) error
+
+	// ReadonlyFlag and NoLockFlag report the bit values the backend uses
+	// for the lmdb.Readonly and lmdb.NoLock flags respectively, in case a
+	// workalike engine assigns them differently than lmdb-go.
+	ReadonlyFlag() uint
+	NoLockFlag() uint
+
+	// IsMapResized and IsMapFull classify an error returned from a
+	// transaction as equivalent to lmdb.MapResized or lmdb.MapFull.
+	IsMapResized(err error) bool
+	IsMapFull(err error) bool
+
+	// MapSize and PageSize report the environment's current map size and
+	// page size in bytes, for use by a MapResizer.  A backend that manages
+	// its map geometry automatically (as MDBX does) may return
+	// (0, 0, nil) to signal that MapFullHandler's growth logic is
+	// unnecessary.
+	MapSize() (int64, error)
+	PageSize() (int64, error)
+}
+
+// lmdbBackend is the Backend implementation used by NewEnv, wrapping an
+// *lmdb.Env directly.
+type lmdbBackend struct {
+	env *lmdb.Env
+}
+
+func (b *lmdbBackend) Open(path string, flags uint, mode os.FileMode) error {
+	return b.env.Open(path, flags, mode)
+}
+
+func (b *lmdbBackend) SetFlags(flags uint) error   { return b.env.SetFlags(flags) }
+func (b *lmdbBackend) UnsetFlags(flags uint) error { return b.env.UnsetFlags(flags) }
+func (b *lmdbBackend) Flags() (uint, error)        { return b.env.Flags() }
+func (b *lmdbBackend) SetMapSize(size int64) error { return b.env.SetMapSize(size) }
+
+func (b *lmdbBackend) RunTxn(flags uint, op TxnOp) error {
+	return b.env.RunTxn(flags, func(txn *lmdb.Txn) error { return op(txn) })
+}
+func (b *lmdbBackend) View(op TxnOp) error {
+	return b.env.View(func(txn *lmdb.Txn) error { return op(txn) })
+}
+func (b *lmdbBackend) Update(op TxnOp) error {
+	return b.env.Update(func(txn *lmdb.Txn) error { return op(txn) })
+}
+func (b *lmdbBackend) UpdateLocked(op TxnOp) error {
+	return b.env.UpdateLocked(func(txn *lmdb.Txn) error { return op(txn) })
+}
+
+func (b *lmdbBackend) ReadonlyFlag() uint { return lmdb.Readonly }
+func (b *lmdbBackend) NoLockFlag() uint   { return lmdb.NoLock }
+
+func (b *lmdbBackend) IsMapResized(err error) bool { return lmdb.IsMapResized(err) }
+func (b *lmdbBackend) IsMapFull(err error) bool    { return lmdb.IsMapFull(err) }
+
+func (b *lmdbBackend) MapSize() (int64, error) {
+	info, err := b.env.Info()
+	if err != nil {
+		return 0, err
+	}
+	return int64(info.MapSize), nil
+}
+
+func (b *lmdbBackend) PageSize() (int64, error) {
+	stat, err := b.env.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.PSize), nil
+}
+
+// LMDBEnv returns the *lmdb.Env wrapped by env, if env was constructed with
+// NewEnv (or NewEnvWithBackend given the Backend of an Env built by NewEnv).
+// It returns nil for any other Backend, such as one wrapping mdbx-go or a
+// caller's own wrapper of an *lmdb.Env.
+func (r *Env) LMDBEnv() *lmdb.Env {
+	b, _ := r.backend.(*lmdbBackend)
+	if b == nil {
+		return nil
+	}
+	return b.env
+}
@@ -0,0 +1,73 @@
+//go:build mdbx
+
+package lmdbsync
+
+import (
+	"os"
+
+	"github.com/PowerDNS/mdbx-go/mdbx"
+)
+
+// mdbxBackend is a Backend implementation wrapping an *mdbx.Env, allowing
+// Env to drive an MDBX environment instead of LMDB.  It is only compiled
+// with the "mdbx" build tag, since mdbx-go links against libmdbx rather
+// than liblmdb and most consumers of this package do not need both.
+type mdbxBackend struct {
+	env *mdbx.Env
+}
+
+// NewMDBXBackend wraps env, an already-allocated *mdbx.Env, for use with
+// NewEnvWithBackend.  If env is nil, mdbx.NewEnv() is called to allocate
+// one.
+func NewMDBXBackend(env *mdbx.Env) (Backend, error) {
+	var err error
+	if env == nil {
+		env, err = mdbx.NewEnv()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &mdbxBackend{env: env}, nil
+}
+
+func (b *mdbxBackend) Open(path string, flags uint, mode os.FileMode) error {
+	return b.env.Open(path, flags, mode)
+}
+
+func (b *mdbxBackend) SetFlags(flags uint) error   { return b.env.SetFlags(flags) }
+func (b *mdbxBackend) UnsetFlags(flags uint) error { return b.env.UnsetFlags(flags) }
+func (b *mdbxBackend) Flags() (uint, error)        { return b.env.Flags() }
+
+// SetMapSize is a no-op returning nil.  MDBX manages its map geometry
+// automatically and grows the map itself as needed; see MapSize.
+func (b *mdbxBackend) SetMapSize(size int64) error { return nil }
+
+func (b *mdbxBackend) RunTxn(flags uint, op TxnOp) error {
+	return b.env.RunTxn(flags, func(txn *mdbx.Txn) error { return op(txn) })
+}
+func (b *mdbxBackend) View(op TxnOp) error {
+	return b.env.View(func(txn *mdbx.Txn) error { return op(txn) })
+}
+func (b *mdbxBackend) Update(op TxnOp) error {
+	return b.env.Update(func(txn *mdbx.Txn) error { return op(txn) })
+}
+func (b *mdbxBackend) UpdateLocked(op TxnOp) error {
+	return b.env.UpdateLocked(func(txn *mdbx.Txn) error { return op(txn) })
+}
+
+func (b *mdbxBackend) ReadonlyFlag() uint { return uint(mdbx.Readonly) }
+func (b *mdbxBackend) NoLockFlag() uint   { return uint(mdbx.NoLock) }
+
+func (b *mdbxBackend) IsMapResized(err error) bool { return mdbx.IsMapResized(err) }
+
+// IsMapFull always returns false for MDBX: with its automatic geometry
+// management an out-of-space condition surfaces as mdbx.MapFull only once
+// the configured geometry ceiling is reached, which this backend reports
+// through MapSize/PageSize returning zero instead of asking MapFullHandler
+// to grow anything.
+func (b *mdbxBackend) IsMapFull(err error) bool { return false }
+
+// MapSize and PageSize return (0, nil), signaling MapFullHandler that this
+// backend's geometry is managed automatically and does not need growing.
+func (b *mdbxBackend) MapSize() (int64, error)  { return 0, nil }
+func (b *mdbxBackend) PageSize() (int64, error) { return 0, nil }
@@ -0,0 +1,112 @@
+package lmdbsync
+
+import "context"
+
+type ctxBagKey int
+
+// BagContext returns the context.Context active for the transaction
+// associated with b, as set by one of Env's *Context methods.  It returns
+// context.Background() if b was not derived from a *Context call, so
+// Handlers can consult it unconditionally.
+func BagContext(b Bag) context.Context {
+	ctx, _ := b.Value(ctxBagKey(0)).(context.Context)
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+func bagWithContext(b Bag, ctx context.Context) Bag {
+	return BagWith(b, ctxBagKey(0), ctx)
+}
+
+// RunTxnContext is like RunTxn but aborts if ctx is done, either while
+// waiting to acquire the transaction lock or between handler-chain retries.
+// Because the underlying mdb_txn cannot itself be cancelled, a transaction
+// already running when ctx is done will still run fn to completion; only
+// the waiting and retrying is interrupted.
+func (r *Env) RunTxnContext(ctx context.Context, flags uint, op TxnOp) error {
+	readonly := flags&r.backend.ReadonlyFlag() != 0
+	return r.runHandlerCtx(ctx, readonly, func() error { return r.backend.RunTxn(flags, op) }, r.Handlers)
+}
+
+// ViewContext is like View but aborts if ctx is done, either while waiting
+// to acquire the transaction lock or between handler-chain retries.
+func (r *Env) ViewContext(ctx context.Context, op TxnOp) error {
+	return r.runHandlerCtx(ctx, true, func() error { return r.backend.View(op) }, r.Handlers)
+}
+
+// UpdateContext is like Update but aborts if ctx is done, either while
+// waiting to acquire the transaction lock or between handler-chain retries.
+func (r *Env) UpdateContext(ctx context.Context, op TxnOp) error {
+	return r.runHandlerCtx(ctx, false, func() error { return r.backend.Update(op) }, r.Handlers)
+}
+
+// UpdateLockedContext is like UpdateLocked but aborts if ctx is done, either
+// while waiting to acquire the transaction lock or between handler-chain
+// retries.
+func (r *Env) UpdateLockedContext(ctx context.Context, op TxnOp) error {
+	return r.runHandlerCtx(ctx, false, func() error { return r.backend.UpdateLocked(op) }, r.Handlers)
+}
+
+func (r *Env) runHandlerCtx(ctx context.Context, readonly bool, fn func() error, h Handler) error {
+	if err := r.runBefore(); err != nil {
+		return err
+	}
+	b := bagWithContext(bagWithEnv(r.bag, r), ctx)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := r.runCtx(ctx, readonly, fn)
+		if err == ctx.Err() && err != nil {
+			return err
+		}
+
+		b, err = h.HandleTxnErr(b, err)
+		if err != RetryTxn {
+			return err
+		}
+	}
+}
+
+// runCtx is like run but selects on ctx.Done() while waiting to acquire
+// txnlock.  If ctx is done first, the in-flight lock attempt is allowed to
+// complete in the background and is released immediately, rather than
+// leaving txnlock permanently held; fn is never called in that case.
+func (r *Env) runCtx(ctx context.Context, readonly bool, fn func() error) error {
+	write := r.noLock && !readonly
+
+	acquired := make(chan struct{})
+	go func() {
+		if write {
+			r.txnlock.Lock()
+		} else {
+			r.txnlock.RLock()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+	case <-ctx.Done():
+		go func() {
+			<-acquired
+			if write {
+				r.txnlock.Unlock()
+			} else {
+				r.txnlock.RUnlock()
+			}
+		}()
+		return ctx.Err()
+	}
+
+	err := fn()
+	if write {
+		r.txnlock.Unlock()
+	} else {
+		r.txnlock.RUnlock()
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package lmdbsync
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUpdateContextCancelledBeforeStart(t *testing.T) {
+	backend := newFakeBackend()
+	env, err := NewEnvWithBackend(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ran := false
+	err = env.UpdateContext(ctx, func(txn interface{}) error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if ran {
+		t.Fatal("op ran despite an already-cancelled context")
+	}
+}
+
+// alwaysRetryMapFullHandler asks for a retry on every errFakeMapFull, so a
+// *Context method's retry loop has something to cancel out of between
+// attempts.
+type alwaysRetryMapFullHandler struct{}
+
+func (alwaysRetryMapFullHandler) HandleTxnErr(b Bag, err error) (Bag, error) {
+	if err == nil {
+		return b, nil
+	}
+	return b, RetryTxn
+}
+
+func TestUpdateContextCancelledBetweenRetries(t *testing.T) {
+	backend := newFakeBackend()
+	env, err := NewEnvWithBackend(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Handlers = HandlerChain{alwaysRetryMapFullHandler{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := 0
+	err = env.UpdateContext(ctx, func(txn interface{}) error {
+		attempts++
+		if attempts == 2 {
+			cancel()
+		}
+		return errFakeMapFull
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("attempts = %d, want 2 (loop should stop once ctx is cancelled)", attempts)
+	}
+}
+
+func TestBagContextDefaultsToBackground(t *testing.T) {
+	b := Background()
+	if BagContext(b) != context.Background() {
+		t.Fatal("BagContext of a plain Bag should be context.Background()")
+	}
+}
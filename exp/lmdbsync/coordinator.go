@@ -0,0 +1,250 @@
+package lmdbsync
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// mapsizeMagic and mapsizeVersion identify the sidecar file format written
+// by SharedMapSizeCoordinator.  The on-disk layout is:
+//
+//	offset 0:  4 bytes  magic
+//	offset 4:  4 bytes  version
+//	offset 8:  8 bytes  map size (bytes, big-endian uint64)
+//	offset 16: 8 bytes  generation (big-endian uint64)
+const (
+	mapsizeMagic   = 0x6c6d6462 // "lmdb"
+	mapsizeVersion = 1
+	mapsizeFileLen = 24
+)
+
+// DefaultCoordinatorFile is the conventional name of the sidecar file inside
+// an environment's directory.  NewSharedMapSizeCoordinator does not append
+// it; callers pass the joined path, e.g. filepath.Join(dbpath,
+// DefaultCoordinatorFile).
+const DefaultCoordinatorFile = "mapsize"
+
+// SharedMapSizeCoordinator coordinates Env.SetMapSize across multiple
+// processes that share the same LMDB environment.  It does so through a
+// small sidecar file, protected by advisory (flock) locking, that
+// records the current map size and a generation counter.  Every
+// transaction consults the file (a stat, with the file re-read only when
+// its mtime differs from the cached one) and adopts a newer size before proceeding, the
+// same way Env already adopts a size learned from a MapResized error.
+//
+// Construct one with NewSharedMapSizeCoordinator and install its Handler
+// with Env.WithHandler (or append it to Env.Handlers) so that generation
+// bumps observed mid-transaction trigger a retry.
+type SharedMapSizeCoordinator struct {
+	path string
+
+	mu          sync.Mutex
+	cachedMtime time.Time
+	generation  uint64
+}
+
+// NewSharedMapSizeCoordinator returns a coordinator backed by the sidecar
+// file at path.  path is typically derived from the environment's own path,
+// for example filepath.Join(dbpath, DefaultCoordinatorFile).  The file is
+// created, if it does not already exist, recording initialSize as the
+// environment's current map size.
+func NewSharedMapSizeCoordinator(path string, initialSize int64) (*SharedMapSizeCoordinator, error) {
+	c := &SharedMapSizeCoordinator{path: path}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := lockFile(f); err != nil {
+		return nil, err
+	}
+	defer unlockFile(f)
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		if err := writeMapsizeFile(f, uint64(initialSize), 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Before implements Coordinator.  Install c with env.SetCoordinator(c) so
+// Env calls Before at the start of every reader and writer transaction,
+// before the underlying Backend's RunTxn/View/Update is invoked, adopting a
+// size bump made by another process (subject to the delay described below)
+// before the transaction begins.  Consulting the sidecar file only when the
+// cached mtime looks stale keeps the common case to a single stat call.
+func (c *SharedMapSizeCoordinator) Before(env *Env) error {
+	size, delay, changed, err := c.poll()
+	if err != nil || !changed {
+		return err
+	}
+	return env.setMapSize(size, delay)
+}
+
+// poll reads the sidecar file if it appears to have changed since the last
+// read, returning the size and generation-appropriate delay recorded there.
+func (c *SharedMapSizeCoordinator) poll() (size int64, delay time.Duration, changed bool, err error) {
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	c.mu.Lock()
+	stale := !fi.ModTime().Equal(c.cachedMtime)
+	c.mu.Unlock()
+	if !stale {
+		return 0, 0, false, nil
+	}
+
+	f, err := os.Open(c.path)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer f.Close()
+
+	if err := lockFileShared(f); err != nil {
+		return 0, 0, false, err
+	}
+	defer unlockFile(f)
+
+	sz, gen, err := readMapsizeFile(f)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	c.mu.Lock()
+	changedGen := gen != c.generation
+	c.generation = gen
+	c.cachedMtime = fi.ModTime()
+	c.mu.Unlock()
+
+	// A small delay gives the process that grew the map a head start
+	// finishing its own SetMapSize before peers attempt to read with the
+	// new size in effect.
+	return int64(sz), 10 * time.Millisecond, changedGen, nil
+}
+
+// SetMapSize calls env.SetMapSize(size) and, if that succeeds, writes size
+// to the sidecar file, bumping its generation counter.  Callers should use this in
+// place of calling env.SetMapSize directly so that peer processes observe
+// the change.
+func (c *SharedMapSizeCoordinator) SetMapSize(env *Env, size int64) error {
+	f, err := os.OpenFile(c.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	_, gen, err := readMapsizeFile(f)
+	if err != nil {
+		return err
+	}
+	gen++
+
+	if err := env.SetMapSize(size); err != nil {
+		return err
+	}
+	if err := writeMapsizeFile(f, uint64(size), gen); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.generation = gen
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Handler returns a Handler that can be appended to an Env's handler chain
+// as a fallback alongside Before (which is the proactive path taken once
+// SetCoordinator is used).  It notices a generation bump to the sidecar
+// file that a peer process made mid-transaction and, if the attempt that
+// just ran actually failed, requests a retry so it is re-run with the
+// latest map size in effect.  A transaction that already succeeded is never
+// retried here even if the generation has since moved, since op may not be
+// idempotent and the commit cannot be undone; the new size is still adopted
+// immediately so the next transaction picks it up.
+func (c *SharedMapSizeCoordinator) Handler() Handler {
+	return HandlerFunc(func(b Bag, err error) (Bag, error) {
+		env := BagEnv(b)
+		if env == nil {
+			return b, err
+		}
+
+		size, delay, changed, perr := c.poll()
+		if perr != nil || !changed {
+			return b, err
+		}
+
+		if serr := env.setMapSize(size, delay); serr != nil {
+			return b, serr
+		}
+		if err == nil {
+			return b, nil
+		}
+		return b, RetryTxn
+	})
+}
+
+func writeMapsizeFile(f *os.File, size, generation uint64) error {
+	var buf [mapsizeFileLen]byte
+	binary.BigEndian.PutUint32(buf[0:4], mapsizeMagic)
+	binary.BigEndian.PutUint32(buf[4:8], mapsizeVersion)
+	binary.BigEndian.PutUint64(buf[8:16], size)
+	binary.BigEndian.PutUint64(buf[16:24], generation)
+
+	if _, err := f.WriteAt(buf[:], 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func readMapsizeFile(f *os.File) (size, generation uint64, err error) {
+	var buf [mapsizeFileLen]byte
+	if _, err := f.ReadAt(buf[:], 0); err != nil {
+		return 0, 0, err
+	}
+
+	magic := binary.BigEndian.Uint32(buf[0:4])
+	version := binary.BigEndian.Uint32(buf[4:8])
+	if magic != mapsizeMagic {
+		return 0, 0, fmt.Errorf("lmdbsync: %s: bad magic", filepath.Base(f.Name()))
+	}
+	if version != mapsizeVersion {
+		return 0, 0, fmt.Errorf("lmdbsync: %s: unsupported version %d", filepath.Base(f.Name()), version)
+	}
+
+	size = binary.BigEndian.Uint64(buf[8:16])
+	generation = binary.BigEndian.Uint64(buf[16:24])
+	return size, generation, nil
+}
+
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func lockFileShared(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_SH)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,134 @@
+package lmdbsync
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestCoordinatorPath(t *testing.T) string {
+	t.Helper()
+	return filepath.Join(t.TempDir(), DefaultCoordinatorFile)
+}
+
+func newTestCoordinatorEnv(t *testing.T) (*Env, *fakeBackend) {
+	t.Helper()
+	backend := newFakeBackend()
+	env, err := NewEnvWithBackend(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env, backend
+}
+
+// newTestPeers returns two SharedMapSizeCoordinators sharing the same
+// sidecar file, standing in for the coordinators two different processes
+// would construct against the same database.
+func newTestPeers(t *testing.T, size int64) (writer, reader *SharedMapSizeCoordinator) {
+	t.Helper()
+	path := newTestCoordinatorPath(t)
+	writer, err := NewSharedMapSizeCoordinator(path, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err = NewSharedMapSizeCoordinator(path, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writer, reader
+}
+
+// TestCoordinatorHandlerDoesNotRetrySuccess is a regression test: a
+// generation bump that a peer process made between this process's last
+// poll and the end of a just-committed transaction must not cause that
+// transaction to be re-run, since its op may not be idempotent.
+func TestCoordinatorHandlerDoesNotRetrySuccess(t *testing.T) {
+	writerCoord, readerCoord := newTestPeers(t, 1<<20)
+	env, backend := newTestCoordinatorEnv(t)
+	env.Handlers = HandlerChain{readerCoord.Handler()}
+
+	writerEnv, _ := newTestCoordinatorEnv(t)
+	if err := writerCoord.SetMapSize(writerEnv, 2<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := 0
+	err := env.Update(func(txn interface{}) error {
+		attempts++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("attempts = %d, want 1 (committed transaction must not be re-run)", attempts)
+	}
+	if size, _ := backend.MapSize(); size != 2<<20 {
+		t.Fatalf("mapSize = %d, want %d (new size should still be adopted)", size, 2<<20)
+	}
+}
+
+// TestCoordinatorHandlerRetriesFailure checks that a transaction which
+// actually failed is retried once the coordinator notices a peer's size
+// bump, so it gets a chance to run again with the new size in effect.
+func TestCoordinatorHandlerRetriesFailure(t *testing.T) {
+	writerCoord, readerCoord := newTestPeers(t, 1<<20)
+	env, backend := newTestCoordinatorEnv(t)
+	env.Handlers = HandlerChain{readerCoord.Handler()}
+
+	writerEnv, _ := newTestCoordinatorEnv(t)
+	if err := writerCoord.SetMapSize(writerEnv, 2<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := 0
+	err := env.Update(func(txn interface{}) error {
+		attempts++
+		if attempts == 1 {
+			return errFakeMapFull
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("attempts = %d, want 2", attempts)
+	}
+	if size, _ := backend.MapSize(); size != 2<<20 {
+		t.Fatalf("mapSize = %d, want %d", size, 2<<20)
+	}
+}
+
+func TestSharedMapSizeCoordinatorRoundTrip(t *testing.T) {
+	writerCoord, readerCoord := newTestPeers(t, 1<<20)
+	writerEnv, _ := newTestCoordinatorEnv(t)
+	readerEnv, readerBackend := newTestCoordinatorEnv(t)
+
+	if err := writerCoord.SetMapSize(writerEnv, 4<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := readerCoord.Before(readerEnv); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := readerBackend.MapSize(); size != 4<<20 {
+		t.Fatalf("readerBackend mapSize = %d, want %d", size, 4<<20)
+	}
+}
+
+func TestEnvSetCoordinatorRunsBefore(t *testing.T) {
+	writerCoord, readerCoord := newTestPeers(t, 1<<20)
+	writerEnv, _ := newTestCoordinatorEnv(t)
+	if err := writerCoord.SetMapSize(writerEnv, 8<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	env, backend := newTestCoordinatorEnv(t)
+	env.SetCoordinator(readerCoord)
+
+	if err := env.View(func(txn interface{}) error { return nil }); err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if size, _ := backend.MapSize(); size != 8<<20 {
+		t.Fatalf("mapSize = %d, want %d (SetCoordinator should run Before proactively)", size, 8<<20)
+	}
+}
@@ -0,0 +1,73 @@
+package lmdbsync
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// errFakeMapFull and errFakeMapResized stand in for lmdb.MapFull and
+// lmdb.MapResized so tests can drive the handler chain without a live LMDB
+// environment.
+var (
+	errFakeMapFull    = errors.New("lmdbsync: fake map full")
+	errFakeMapResized = errors.New("lmdbsync: fake map resized")
+)
+
+const (
+	fakeReadonly = 1 << iota
+	fakeNoLock
+)
+
+// fakeTxn is the concrete transaction type fakeBackend hands to a TxnOp,
+// standing in for *lmdb.Txn/*mdbx.Txn.
+type fakeTxn struct{}
+
+// fakeBackend is a minimal Backend good enough to exercise Env's
+// handler-chain and retry logic in tests, without opening a real
+// environment.
+type fakeBackend struct {
+	mu       sync.Mutex
+	flags    uint
+	mapSize  int64
+	pageSize int64
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{mapSize: 1 << 20, pageSize: 4096}
+}
+
+func (b *fakeBackend) Open(path string, flags uint, mode os.FileMode) error { return nil }
+func (b *fakeBackend) SetFlags(flags uint) error                            { b.flags |= flags; return nil }
+func (b *fakeBackend) UnsetFlags(flags uint) error                          { b.flags &^= flags; return nil }
+func (b *fakeBackend) Flags() (uint, error)                                 { return b.flags, nil }
+
+func (b *fakeBackend) SetMapSize(size int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.mapSize = size
+	return nil
+}
+
+func (b *fakeBackend) RunTxn(flags uint, op TxnOp) error { return op(&fakeTxn{}) }
+func (b *fakeBackend) View(op TxnOp) error               { return op(&fakeTxn{}) }
+func (b *fakeBackend) Update(op TxnOp) error             { return op(&fakeTxn{}) }
+func (b *fakeBackend) UpdateLocked(op TxnOp) error       { return op(&fakeTxn{}) }
+
+func (b *fakeBackend) ReadonlyFlag() uint { return fakeReadonly }
+func (b *fakeBackend) NoLockFlag() uint   { return fakeNoLock }
+
+func (b *fakeBackend) IsMapResized(err error) bool { return errors.Is(err, errFakeMapResized) }
+func (b *fakeBackend) IsMapFull(err error) bool    { return errors.Is(err, errFakeMapFull) }
+
+func (b *fakeBackend) MapSize() (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.mapSize, nil
+}
+
+func (b *fakeBackend) PageSize() (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pageSize, nil
+}
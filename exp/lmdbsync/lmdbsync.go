@@ -4,9 +4,18 @@ cost of performance.  The package provides a drop-in replacement for *lmdb.Env
 that can be used in situations where the database may be resized or where the
 flag lmdb.NoLock is used.
 
-Bypassing an Env's methods to access the underlying lmdb.Env is safe.  The
+Env drives a Backend rather than an *lmdb.Env directly.  NewEnv wraps
+lmdb-go's *lmdb.Env for the common case; NewEnvWithBackend accepts any other
+Backend implementation, such as one wrapping mdbx-go, so long as it presents
+lmdb-compatible flags and errno values.  Because a Backend's transactions
+are not necessarily *lmdb.Txn, Env's transaction-running methods take a
+TxnOp, which receives its Backend's concrete transaction type as an
+interface{}; callers write ops against whichever backend they configured
+their Env with.
+
+Bypassing an Env's methods to access the underlying Backend is not safe.  The
 severity of such usage depends such behavior should be strictly avoided as it
-may produce undefined behavior from the LMDB C library.
+may produce undefined behavior from the underlying C library.
 
 Resizing the environment
 
@@ -32,6 +41,14 @@ before SetMapSize is called on the underlying lmdb.Env.
 
 See mdb_txn_begin and MDB_MAP_RESIZED.
 
+Applications that proactively grow the map (rather than waiting on
+MapResized) still need to tell peer processes about it; SharedMapSizeCoordinator
+does this through a small sidecar file next to the database, protected by
+advisory locking.  Install one with Env.SetCoordinator so its Before method
+runs at the start of every transaction, adopting a peer's size bump before
+the transaction begins; its Handler is a fallback that notices a bump a
+peer made mid-transaction and retries only the attempts that actually failed.
+
 NoLock
 
 The lmdb.NoLock flag performs all transaction synchronization with Go
@@ -40,14 +57,40 @@ provides.
 
 See mdb_env_open and MDB_NOLOCK.
 
+Retrying
+
+When a Handler returns RetryTxn, runHandler loops back and runs the
+transaction again immediately, with no limit or delay between attempts.
+Under contention (for example a peer process resizing the map repeatedly) an
+unpaced retry loop can spin a CPU core.  Wrap a Handler with WithRetryPolicy
+to bound the number of attempts and space them out with a backoff, so that
+application code does not need to reimplement pacing around every Handler
+it installs.
+
 MapFull
 
-The Env type does no special handling of the MapFull error.  If a call to
-Txn.Put() or Cursor.Put() returns lmdb.MapFull it is the application's
+By default the Env type does no special handling of the MapFull error.  If a
+call to Txn.Put() or Cursor.Put() returns lmdb.MapFull it is the application's
 prerogative to detect the error, call Env.SetMapSize, and retry the transaction
 as necessary.
 
+Applications that would rather have this handled for them can install a
+Handler returned by MapFullHandler, which grows the map according to a
+MapResizer policy (FixedResizer, GeometricResizer, or a custom
+MapResizerFunc) and retries the transaction with the new size in effect.  A
+MaxResizes limit guards against unbounded growth.
+
 See mdb_env_set_mapsize and MDB_MAP_FULL.
+
+Context
+
+RunTxnContext, ViewContext, UpdateContext, and UpdateLockedContext accept a
+context.Context and return early if it is done, either while waiting to
+acquire the transaction lock or between handler-chain retries.  A Handler
+can consult the active context with BagContext(b).  Because the underlying
+mdb_txn has no way to be cancelled once running, a transaction already in
+progress when the context is done still runs to completion; only the
+waiting and retrying around it is interrupted.
 */
 package lmdbsync
 
@@ -71,8 +114,9 @@ func bagWithEnv(b Bag, env *Env) Bag {
 	return BagWith(b, envBagKey(0), env)
 }
 
-// Env wraps an *lmdb.Env, receiving all the same methods and proxying some to
-// provide transaction management.  Transactions run by an Env handle
+// Env wraps a Backend, proxying its methods to provide transaction
+// management.  Backend methods that Env does not proxy are reached through
+// Env.Backend (or Env.LMDBEnv).  Transactions run by an Env handle
 // lmdb.MapResized error transparently through additional synchronization.
 // Additionally, Env is safe to use on environments setting the lmdb.NoLock
 // flag.  When in NoLock mode write transactions block all read transactions
@@ -81,20 +125,51 @@ func bagWithEnv(b Bag, env *Env) Bag {
 //
 // Env proxies several methods to provide synchronization required for safe
 // operation in some scenarios.  It is important not byprass proxies and call
-// the methods directly on the underlying lmdb.Env or synchronization may be
-// interfered with.  Calling proxied methods directly on the lmdb.Env may
+// the methods directly on the underlying Backend or synchronization may be
+// interfered with.  Calling proxied methods directly on the Backend may
 // result in poor transaction performance or unspecified behavior in from the C
 // library.
 type Env struct {
-	*lmdb.Env
-	Handlers HandlerChain
-	bag      Bag
-	noLock   bool
-	txnlock  sync.RWMutex
+	backend     Backend
+	Handlers    HandlerChain
+	bag         Bag
+	noLock      bool
+	txnlock     sync.RWMutex
+	coordinator Coordinator
+}
+
+// Coordinator is consulted by Env at the start of every transaction it
+// runs, before the Backend's RunTxn/View/Update/UpdateLocked is invoked,
+// so that state shared outside the process (such as a map size bump
+// recorded by a peer) is adopted proactively rather than only discovered
+// after a transaction fails.  SharedMapSizeCoordinator implements
+// Coordinator.  Install one with SetCoordinator.
+type Coordinator interface {
+	Before(env *Env) error
+}
+
+// SetCoordinator installs c to be consulted by Before at the start of
+// every call to RunTxn, View, Update, UpdateLocked, and their Context
+// variants.  Passing nil removes any previously installed Coordinator.
+func (r *Env) SetCoordinator(c Coordinator) {
+	r.coordinator = c
 }
 
-// NewEnv returns an newly allocated Env that wraps env.  If env is nil then
-// lmdb.NewEnv() will be called to allocate an lmdb.Env.
+// runBefore calls r.coordinator.Before, if one is installed.
+func (r *Env) runBefore() error {
+	if r.coordinator == nil {
+		return nil
+	}
+	return r.coordinator.Before(r)
+}
+
+// NewEnv returns an newly allocated Env wrapping env in a Backend built for
+// lmdb-go.  If env is nil then lmdb.NewEnv() will be called to allocate an
+// lmdb.Env.
+//
+// NewEnv is a convenience wrapper around NewEnvWithBackend for the common
+// case of running against lmdb-go itself.  Use NewEnvWithBackend to run
+// against a different Backend, such as one wrapping mdbx-go.
 func NewEnv(env *lmdb.Env, h ...Handler) (*Env, error) {
 	var err error
 	if env == nil {
@@ -103,19 +178,26 @@ func NewEnv(env *lmdb.Env, h ...Handler) (*Env, error) {
 			return nil, err
 		}
 	}
+	return NewEnvWithBackend(&lmdbBackend{env: env}, h...)
+}
 
-	flags, err := env.Flags()
+// NewEnvWithBackend returns a newly allocated Env driving backend.  It
+// allows callers to run lmdbsync's handler-chain, MapResized retry, and
+// NoLock gating logic against storage engines other than lmdb-go, such as
+// mdbx-go, by supplying a suitable Backend implementation.
+func NewEnvWithBackend(backend Backend, h ...Handler) (*Env, error) {
+	flags, err := backend.Flags()
 	if lmdb.IsErrnoSys(err, syscall.EINVAL) {
 		err = nil
 	} else if err != nil {
 		return nil, err
 	}
-	noLock := flags&lmdb.NoLock != 0
+	noLock := flags&backend.NoLockFlag() != 0
 
 	chain := append(HandlerChain(nil), h...)
 
 	_env := &Env{
-		Env:      env,
+		backend:  backend,
 		Handlers: chain,
 		noLock:   noLock,
 		bag:      Background(),
@@ -123,61 +205,68 @@ func NewEnv(env *lmdb.Env, h ...Handler) (*Env, error) {
 	return _env, nil
 }
 
-// Open is a proxy for r.Env.Open() that detects the lmdb.NoLock flag to
+// Backend returns the Backend wrapped by r.
+func (r *Env) Backend() Backend {
+	return r.backend
+}
+
+// Open is a proxy for r.backend.Open() that detects the NoLock flag to
 // properly manage transaction synchronization.
 func (r *Env) Open(path string, flags uint, mode os.FileMode) error {
-	err := r.Env.Open(path, flags, mode)
+	err := r.backend.Open(path, flags, mode)
 	if err != nil {
 		// no update to flags occurred
 		return err
 	}
 
-	if flags&lmdb.NoLock != 0 {
+	if flags&r.backend.NoLockFlag() != 0 {
 		r.noLock = true
 	}
 
 	return nil
 }
 
-// SetFlags is a proxy for r.Env.SetFlags() that detects the lmdb.NoLock flag
+// SetFlags is a proxy for r.backend.SetFlags() that detects the NoLock flag
 // to properly manage transaction synchronization.
 func (r *Env) SetFlags(flags uint) error {
-	err := r.Env.SetFlags(flags)
+	err := r.backend.SetFlags(flags)
 	if err != nil {
 		// no update to flags occurred
 		return err
 	}
 
-	if flags&lmdb.NoLock != 0 {
+	if flags&r.backend.NoLockFlag() != 0 {
 		r.noLock = true
 	}
 
 	return nil
 }
 
-// UnsetFlags is a proxy for r.Env.UnsetFlags() that detects the lmdb.NoLock flag
-// to properly manage transaction synchronization.
+// UnsetFlags is a proxy for r.backend.UnsetFlags() that detects the NoLock
+// flag to properly manage transaction synchronization.
 func (r *Env) UnsetFlags(flags uint) error {
-	err := r.Env.UnsetFlags(flags)
+	err := r.backend.UnsetFlags(flags)
 	if err != nil {
 		// no update to flags occurred
 		return err
 	}
 
-	if flags&lmdb.NoLock != 0 {
+	if flags&r.backend.NoLockFlag() != 0 {
 		r.noLock = false
 	}
 
 	return nil
 }
 
-// SetMapSize is a proxy for r.Env.SetMapSize() that blocks while concurrent
-// transactions are in progress.
+// Flags is a proxy for r.backend.Flags().
+func (r *Env) Flags() (uint, error) {
+	return r.backend.Flags()
+}
+
+// SetMapSize is a proxy for r.backend.SetMapSize() that blocks while
+// concurrent transactions are in progress.
 func (r *Env) SetMapSize(size int64) error {
-	r.txnlock.Lock()
-	err := r.setMapSize(size, 0)
-	r.txnlock.Unlock()
-	return err
+	return r.setMapSize(size, 0)
 }
 
 func (r *Env) setMapSize(size int64, delay time.Duration) error {
@@ -188,60 +277,60 @@ func (r *Env) setMapSize(size int64, delay time.Duration) error {
 		// begin while waiting.
 		time.Sleep(delay)
 	}
-	err := r.Env.SetMapSize(size)
+	err := r.backend.SetMapSize(size)
 	r.txnlock.Unlock()
 	return err
 }
 
-// RunTxn is a proxy for r.Env.RunTxn().
+// RunTxn is a proxy for r.backend.RunTxn().
 //
-// If lmdb.NoLock is set on r.Env then RunTxn will block while other updates
-// are in progress, regardless of flags.
+// If lmdb.NoLock is set on r's Backend then RunTxn will block while other
+// updates are in progress, regardless of flags.
 //
 // If RunTxn returns MapResized it means another process(es) was writing too
 // fast to the database and the calling process could not get a valid
 // transaction handle.
-func (r *Env) RunTxn(flags uint, op lmdb.TxnOp) (err error) {
-	readonly := flags&lmdb.Readonly != 0
-	return r.runHandler(readonly, func() error { return r.Env.RunTxn(flags, op) }, r.Handlers)
+func (r *Env) RunTxn(flags uint, op TxnOp) (err error) {
+	readonly := flags&r.backend.ReadonlyFlag() != 0
+	return r.runHandler(readonly, func() error { return r.backend.RunTxn(flags, op) }, r.Handlers)
 }
 
-// View is a proxy for r.Env.RunTxn().
+// View is a proxy for r.backend.View().
 //
-// If lmdb.NoLock is set on r.Env then View will block until any running update
-// completes.
+// If lmdb.NoLock is set on r's Backend then View will block until any
+// running update completes.
 //
 // If View returns MapResized it means another process(es) was writing too fast
 // to the database and the calling process could not get a valid transaction
 // handle.
-func (r *Env) View(op lmdb.TxnOp) error {
-	return r.runHandler(true, func() error { return r.Env.View(op) }, r.Handlers)
+func (r *Env) View(op TxnOp) error {
+	return r.runHandler(true, func() error { return r.backend.View(op) }, r.Handlers)
 }
 
-// Update is a proxy for r.Env.RunTxn().
+// Update is a proxy for r.backend.Update().
 //
-// If lmdb.NoLock is set on r.Env then Update blocks until all other
+// If lmdb.NoLock is set on r's Backend then Update blocks until all other
 // transactions have terminated and blocks all other transactions from running
 // while in progress (including readonly transactions).
 //
 // If Update returns MapResized it means another process(es) was writing too
 // fast to the database and the calling process could not get a valid
 // transaction handle.
-func (r *Env) Update(op lmdb.TxnOp) error {
-	return r.runHandler(false, func() error { return r.Env.Update(op) }, r.Handlers)
+func (r *Env) Update(op TxnOp) error {
+	return r.runHandler(false, func() error { return r.backend.Update(op) }, r.Handlers)
 }
 
-// UpdateLocked is a proxy for r.Env.RunTxn().
+// UpdateLocked is a proxy for r.backend.UpdateLocked().
 //
-// If lmdb.NoLock is set on r.Env then UpdateLocked blocks until all other
-// transactions have terminated and blocks all other transactions from running
-// while in progress (including readonly transactions).
+// If lmdb.NoLock is set on r's Backend then UpdateLocked blocks until all
+// other transactions have terminated and blocks all other transactions from
+// running while in progress (including readonly transactions).
 //
 // If UpdateLocked returns MapResized it means another process(es) was writing
 // too fast to the database and the calling process could not get a valid
 // transaction handle.
-func (r *Env) UpdateLocked(op lmdb.TxnOp) error {
-	return r.runHandler(false, func() error { return r.Env.UpdateLocked(op) }, r.Handlers)
+func (r *Env) UpdateLocked(op TxnOp) error {
+	return r.runHandler(false, func() error { return r.backend.UpdateLocked(op) }, r.Handlers)
 }
 
 // WithHandler returns a TxnRunner than handles transaction errors r.Handlers
@@ -254,6 +343,9 @@ func (r *Env) WithHandler(h Handler) TxnRunner {
 }
 
 func (r *Env) runHandler(readonly bool, fn func() error, h Handler) error {
+	if err := r.runBefore(); err != nil {
+		return err
+	}
 	b := bagWithEnv(r.bag, r)
 	for {
 		err := r.run(readonly, fn)
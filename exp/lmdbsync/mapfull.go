@@ -0,0 +1,130 @@
+package lmdbsync
+
+import "fmt"
+
+// MapResizer computes the next map size to attempt after a transaction has
+// failed with lmdb.MapFull.  The curSize and pageSize arguments describe the
+// environment's current map size and page size (both in bytes), and
+// numResizes is the number of times the map has already been grown while
+// handling the current run of MapFull errors.  Implementations are expected
+// to return a size that is a multiple of pageSize, as required by
+// Env.SetMapSize.
+type MapResizer interface {
+	Resize(curSize, pageSize int64, numResizes int) (newSize int64)
+}
+
+// MapResizerFunc is a MapResizer implemented by a plain function.
+type MapResizerFunc func(curSize, pageSize int64, numResizes int) int64
+
+// Resize calls fn.
+func (fn MapResizerFunc) Resize(curSize, pageSize int64, numResizes int) int64 {
+	return fn(curSize, pageSize, numResizes)
+}
+
+// FixedResizer returns a MapResizer that grows the map by step bytes each
+// time it is consulted, rounding the result up to a multiple of pageSize.
+func FixedResizer(step int64) MapResizer {
+	return MapResizerFunc(func(curSize, pageSize int64, numResizes int) int64 {
+		return roundPage(curSize+step, pageSize)
+	})
+}
+
+// GeometricResizer returns a MapResizer that doubles the map size on each
+// call, never returning a size larger than max rounded up to a multiple of
+// pageSize (unless curSize is already at least max, in which case curSize is
+// returned unchanged).
+func GeometricResizer(max int64) MapResizer {
+	return MapResizerFunc(func(curSize, pageSize int64, numResizes int) int64 {
+		if curSize >= max {
+			return curSize
+		}
+		next := curSize * 2
+		if next > max {
+			next = max
+		}
+		return roundPage(next, pageSize)
+	})
+}
+
+func roundPage(size, pageSize int64) int64 {
+	if pageSize <= 0 {
+		return size
+	}
+	if rem := size % pageSize; rem != 0 {
+		size += pageSize - rem
+	}
+	return size
+}
+
+// ErrMaxResizes is wrapped and returned by a Handler created by
+// MapFullHandler when an environment's map has been grown MaxResizes times
+// without the calling transaction succeeding.
+var ErrMaxResizes = fmt.Errorf("lmdbsync: maximum number of map resizes exceeded")
+
+// maxResizesError wraps ErrMaxResizes with the number of resizes attempted.
+type maxResizesError struct {
+	numResizes int
+}
+
+func (e *maxResizesError) Error() string {
+	return fmt.Sprintf("%s (%d resizes)", ErrMaxResizes, e.numResizes)
+}
+
+func (e *maxResizesError) Unwrap() error {
+	return ErrMaxResizes
+}
+
+// MapFullHandler returns a Handler that reacts to lmdb.MapFull by growing
+// the environment's map size according to resizer and retrying the failed
+// transaction.  maxResizes bounds the number of consecutive growth attempts
+// made while handling MapFull for a single call into Env; once exceeded the
+// Handler returns an error wrapping ErrMaxResizes instead of retrying
+// forever.
+//
+// MapFullHandler should be installed ahead of application handlers so that
+// MapFull is resolved before other handlers see the error.
+func MapFullHandler(resizer MapResizer, maxResizes int) Handler {
+	return &mapFullHandler{resizer: resizer, maxResizes: maxResizes}
+}
+
+type mapFullHandler struct {
+	resizer    MapResizer
+	maxResizes int
+}
+
+func (h *mapFullHandler) HandleTxnErr(b Bag, err error) (Bag, error) {
+	env := BagEnv(b)
+	if env == nil || !env.backend.IsMapFull(err) {
+		return b, err
+	}
+
+	numResizes, _ := b.Value(mapFullResizesKey(0)).(int)
+	numResizes++
+	if h.maxResizes > 0 && numResizes > h.maxResizes {
+		return b, &maxResizesError{numResizes: numResizes - 1}
+	}
+
+	curSize, perr := env.backend.MapSize()
+	if perr != nil {
+		return b, err
+	}
+	pageSize, perr := env.backend.PageSize()
+	if perr != nil {
+		return b, err
+	}
+	if curSize == 0 && pageSize == 0 {
+		// The backend manages its own map geometry; there is nothing for
+		// MapFullHandler to grow.
+		return b, err
+	}
+
+	newSize := h.resizer.Resize(curSize, pageSize, numResizes-1)
+	if serr := env.SetMapSize(newSize); serr != nil {
+		return b, serr
+	}
+
+	b = BagWith(b, mapFullResizesKey(0), numResizes)
+	return b, RetryTxn
+}
+
+type mapFullResizesKey int
@@ -0,0 +1,61 @@
+package lmdbsync
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMapFullHandlerGrowsAndRetries(t *testing.T) {
+	backend := newFakeBackend()
+	env, err := NewEnvWithBackend(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Handlers = HandlerChain{MapFullHandler(FixedResizer(1<<20), 3)}
+
+	attempts := 0
+	err = env.Update(func(txn interface{}) error {
+		attempts++
+		if attempts < 3 {
+			return errFakeMapFull
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", attempts)
+	}
+
+	size, _ := backend.MapSize()
+	if want := int64(1<<20) + 2*(1<<20); size != want {
+		t.Fatalf("mapSize = %d, want %d", size, want)
+	}
+}
+
+func TestMapFullHandlerMaxResizes(t *testing.T) {
+	backend := newFakeBackend()
+	env, err := NewEnvWithBackend(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Handlers = HandlerChain{MapFullHandler(FixedResizer(1<<20), 1)}
+
+	err = env.Update(func(txn interface{}) error { return errFakeMapFull })
+	if !errors.Is(err, ErrMaxResizes) {
+		t.Fatalf("err = %v, want ErrMaxResizes", err)
+	}
+}
+
+func TestGeometricResizerCapsAtMax(t *testing.T) {
+	resizer := GeometricResizer(3 << 20)
+	next := resizer.Resize(1<<20, 4096, 0)
+	if next != 2<<20 {
+		t.Fatalf("first resize = %d, want %d", next, 2<<20)
+	}
+	next = resizer.Resize(next, 4096, 1)
+	if next != 3<<20 {
+		t.Fatalf("second resize = %d, want cap %d", next, 3<<20)
+	}
+}
@@ -0,0 +1,167 @@
+package lmdbsync
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// ErrorClass categorizes the errors a RetryPolicy treats differently.
+type ErrorClass int
+
+// The error classes a RetryPolicy can override.  ClassOther matches any
+// error not belonging to one of the other classes, including errors that
+// are not retryable at all (a RetryPolicy only ever runs on an error a
+// wrapped Handler has already decided to retry).
+const (
+	ClassOther ErrorClass = iota
+	ClassMapResized
+	ClassMapFull
+	ClassTxnFull
+	ClassKeyExist
+)
+
+func classify(env *Env, err error) ErrorClass {
+	switch {
+	case env != nil && env.backend.IsMapResized(err):
+		return ClassMapResized
+	case env != nil && env.backend.IsMapFull(err):
+		return ClassMapFull
+	case lmdb.IsErrno(err, lmdb.TxnFull):
+		return ClassTxnFull
+	case lmdb.IsErrno(err, lmdb.KeyExist):
+		return ClassKeyExist
+	default:
+		return ClassOther
+	}
+}
+
+// RetryPolicy bounds and paces the retries a Handler performs when it
+// returns RetryTxn.  Used on its own it describes a simple capped
+// exponential backoff; ClassOverrides lets different kinds of error (a slow
+// peer bumping MapResized vs. local contention on a full write transaction)
+// retry on different schedules.
+type RetryPolicy struct {
+	// MaxAttempts bounds the number of times a transaction is retried. Zero
+	// means unlimited.
+	MaxAttempts int
+
+	// InitialDelay is the delay before the first retry.
+	InitialDelay time.Duration
+
+	// Multiplier scales InitialDelay after each retry. A value <= 1
+	// disables backoff and every retry waits InitialDelay.
+	Multiplier float64
+
+	// MaxDelay caps the delay computed from InitialDelay and Multiplier.
+	// Zero means no cap.
+	MaxDelay time.Duration
+
+	// Jitter is the fraction (0 to 1) of the computed delay randomized
+	// above and below its value, to avoid retry storms across processes
+	// converging on the same schedule.
+	Jitter float64
+
+	// ClassOverrides supplies a distinct RetryPolicy for specific
+	// ErrorClass values. A class without an override uses the receiver's
+	// own fields.
+	ClassOverrides map[ErrorClass]RetryPolicy
+
+	// OnRetry, if non-nil, is called before each delay with the attempt
+	// number (starting at 1) and the error being retried, so callers can
+	// hook in metrics or logging.
+	OnRetry func(attempt int, err error)
+}
+
+func (p RetryPolicy) forClass(class ErrorClass) RetryPolicy {
+	if override, ok := p.ClassOverrides[class]; ok {
+		return override
+	}
+	return p
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.InitialDelay
+	if p.Multiplier > 1 {
+		for i := 1; i < attempt; i++ {
+			d = time.Duration(float64(d) * p.Multiplier)
+			if p.MaxDelay > 0 && d > p.MaxDelay {
+				d = p.MaxDelay
+				break
+			}
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 && d > 0 {
+		spread := float64(d) * p.Jitter
+		d = time.Duration(float64(d) - spread + rand.Float64()*2*spread)
+	}
+	return d
+}
+
+// retryExhaustedError is returned in place of RetryTxn once a RetryPolicy's
+// MaxAttempts has been reached for the error class in question.
+type retryExhaustedError struct {
+	class    ErrorClass
+	attempts int
+	err      error
+}
+
+func (e *retryExhaustedError) Error() string {
+	return fmt.Sprintf("lmdbsync: retries exhausted after %d attempts: %s", e.attempts, e.err)
+}
+
+func (e *retryExhaustedError) Unwrap() error { return e.err }
+
+// WithRetryPolicy returns a Handler wrapping h so that, when h's
+// HandleTxnErr returns RetryTxn, the retry is paced (and eventually
+// bounded) by p instead of looping immediately forever.  The error that h
+// was handling is classified with ErrorClass so per-class policies in
+// p.ClassOverrides apply.
+//
+// The attempt counter is carried in the Bag passed between calls, so it
+// resets whenever runHandler starts a fresh call into Env (each top-level
+// RunTxn/View/Update/UpdateLocked).
+func WithRetryPolicy(h Handler, p RetryPolicy) Handler {
+	return &retryPolicyHandler{h: h, policy: p}
+}
+
+type retryPolicyHandler struct {
+	h      Handler
+	policy RetryPolicy
+}
+
+type retryAttemptsKey ErrorClass
+
+func (rh *retryPolicyHandler) HandleTxnErr(b Bag, err error) (Bag, error) {
+	b, herr := rh.h.HandleTxnErr(b, err)
+	if herr != RetryTxn {
+		return b, herr
+	}
+
+	env := BagEnv(b)
+	class := classify(env, err)
+	policy := rh.policy.forClass(class)
+
+	attempt, _ := b.Value(retryAttemptsKey(class)).(int)
+	attempt++
+
+	if policy.MaxAttempts > 0 && attempt > policy.MaxAttempts {
+		return b, &retryExhaustedError{class: class, attempts: attempt - 1, err: err}
+	}
+
+	if policy.OnRetry != nil {
+		policy.OnRetry(attempt, err)
+	}
+
+	if d := policy.delay(attempt); d > 0 {
+		time.Sleep(d)
+	}
+
+	b = BagWith(b, retryAttemptsKey(class), attempt)
+	return b, RetryTxn
+}
@@ -0,0 +1,106 @@
+package lmdbsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// alwaysRetryHandler is a Handler that asks for a retry on every non-nil
+// error, standing in for a Handler that has already decided an error is
+// worth retrying (e.g. MapFullHandler) so WithRetryPolicy's pacing can be
+// tested in isolation.
+type alwaysRetryHandler struct{}
+
+func (alwaysRetryHandler) HandleTxnErr(b Bag, err error) (Bag, error) {
+	if err == nil {
+		return b, nil
+	}
+	return b, RetryTxn
+}
+
+func TestRetryPolicyMaxAttempts(t *testing.T) {
+	backend := newFakeBackend()
+	env, err := NewEnvWithBackend(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var onRetryCalls []int
+	policy := RetryPolicy{
+		MaxAttempts: 2,
+		OnRetry: func(attempt int, err error) {
+			onRetryCalls = append(onRetryCalls, attempt)
+		},
+	}
+	env.Handlers = HandlerChain{WithRetryPolicy(alwaysRetryHandler{}, policy)}
+
+	attempts := 0
+	err = env.Update(func(txn interface{}) error {
+		attempts++
+		return errFakeMapFull
+	})
+
+	var exhausted *retryExhaustedError
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("err = %v, want *retryExhaustedError", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("attempts = %d, want 3 (1 initial + 2 retries)", attempts)
+	}
+	if want := []int{1, 2}; !equalInts(onRetryCalls, want) {
+		t.Fatalf("onRetryCalls = %v, want %v", onRetryCalls, want)
+	}
+}
+
+func TestRetryPolicyClassOverride(t *testing.T) {
+	backend := newFakeBackend()
+	env, err := NewEnvWithBackend(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := RetryPolicy{
+		MaxAttempts: 5,
+		ClassOverrides: map[ErrorClass]RetryPolicy{
+			ClassMapFull: {MaxAttempts: 1},
+		},
+	}
+	env.Handlers = HandlerChain{WithRetryPolicy(alwaysRetryHandler{}, policy)}
+
+	attempts := 0
+	err = env.Update(func(txn interface{}) error {
+		attempts++
+		return errFakeMapFull
+	})
+
+	var exhausted *retryExhaustedError
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("err = %v, want *retryExhaustedError", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("attempts = %d, want 2 (ClassMapFull override caps at 1 retry)", attempts)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{InitialDelay: 10 * time.Millisecond, Multiplier: 2, MaxDelay: 30 * time.Millisecond}
+	if d := p.delay(1); d != 10*time.Millisecond {
+		t.Fatalf("delay(1) = %v, want 10ms", d)
+	}
+	if d := p.delay(3); d != 30*time.Millisecond {
+		t.Fatalf("delay(3) = %v, want capped at 30ms", d)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
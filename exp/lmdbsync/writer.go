@@ -0,0 +1,179 @@
+package lmdbsync
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// DefaultBatchSize is the default value of Writer.BatchSize.
+const DefaultBatchSize = 100
+
+// DefaultBatchDelay is the default value of Writer.BatchDelay.
+const DefaultBatchDelay = time.Millisecond
+
+// Writer funnels write transactions through a single goroutine locked to an
+// OS thread, batching the lmdb.TxnOp of multiple callers into one write
+// transaction.  Batching amortizes the cost of the fsync (or equivalent)
+// performed when a write transaction commits, at the expense of added
+// latency for individual callers.
+//
+// A Writer must be created with NewWriter.  The zero value is not usable.
+type Writer struct {
+	env   *Env
+	inbox chan *writeOp
+
+	// BatchSize is the maximum number of queued ops that will be coalesced
+	// into a single write transaction.  It defaults to DefaultBatchSize.
+	BatchSize int
+
+	// BatchDelay bounds how long the writer goroutine waits for additional
+	// ops to arrive before running a transaction with fewer than BatchSize
+	// ops queued.  It defaults to DefaultBatchDelay.
+	BatchDelay time.Duration
+
+	done chan struct{}
+}
+
+// NewWriter allocates a Writer that submits batched write transactions to
+// env, and starts its writer goroutine.  The caller must call Close to
+// release the goroutine once the Writer is no longer needed.
+//
+// env must be running against a Backend that hands transactions *lmdb.Txn,
+// i.e. one constructed by NewEnv; Writer asserts this when running a batch
+// and panics otherwise.
+func NewWriter(env *Env) *Writer {
+	w := &Writer{
+		env:        env,
+		inbox:      make(chan *writeOp),
+		BatchSize:  DefaultBatchSize,
+		BatchDelay: DefaultBatchDelay,
+		done:       make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+// writeOp is a single caller's queued lmdb.TxnOp along with the channel used
+// to deliver its result.
+type writeOp struct {
+	fn    lmdb.TxnOp
+	reply chan error
+}
+
+// Update submits op to be run in a batched write transaction and blocks
+// until op (and the transaction it was batched into) has completed.  Update
+// may be called concurrently by any number of goroutines, including
+// concurrently with Close: if the Writer is (or becomes) closed before op
+// is queued or run, Update returns ErrWriterClosed instead of blocking
+// forever.
+func (w *Writer) Update(op lmdb.TxnOp) error {
+	wop := &writeOp{fn: op, reply: make(chan error, 1)}
+	select {
+	case w.inbox <- wop:
+	case <-w.done:
+		return ErrWriterClosed
+	}
+	// Once wop has been received into inbox, loop guarantees a reply: either
+	// runBatch completes it or, if Close races with collection, failAll
+	// fails it with ErrWriterClosed.
+	return <-wop.reply
+}
+
+// Close stops the writer goroutine.  Any ops queued but not yet batched into
+// a transaction are failed with ErrWriterClosed.  Close is safe to call
+// concurrently with Update.
+func (w *Writer) Close() error {
+	close(w.done)
+	return nil
+}
+
+// loop runs on its own OS thread for the lifetime of the Writer, batching
+// queued ops into write transactions.
+func (w *Writer) loop() {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	for {
+		var batch []*writeOp
+		select {
+		case <-w.done:
+			return
+		case op := <-w.inbox:
+			batch = append(batch, op)
+		}
+
+		timeout := time.NewTimer(w.BatchDelay)
+	collect:
+		for len(batch) < w.batchSize() {
+			select {
+			case op := <-w.inbox:
+				batch = append(batch, op)
+			case <-timeout.C:
+				break collect
+			case <-w.done:
+				timeout.Stop()
+				w.failAll(batch, ErrWriterClosed)
+				return
+			}
+		}
+		timeout.Stop()
+
+		w.runBatch(batch)
+	}
+}
+
+func (w *Writer) batchSize() int {
+	if w.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return w.BatchSize
+}
+
+// runBatch executes the ops in batch within a single write transaction.  If
+// the whole transaction is aborted (for example by lmdb.MapFull, which the
+// Env's Handlers may or may not have resolved), each op is retried
+// individually so that one failing op does not fail its batch-mates.
+func (w *Writer) runBatch(batch []*writeOp) {
+	results := make([]error, len(batch))
+	err := w.env.UpdateLocked(func(txn interface{}) error {
+		t := txn.(*lmdb.Txn)
+		for i, op := range batch {
+			results[i] = op.fn(t)
+			if results[i] != nil {
+				return results[i]
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for i, op := range batch {
+			op.reply <- results[i]
+		}
+		return
+	}
+
+	// The batch transaction as a whole failed (most likely the op that
+	// returned a non-nil result above, aborting before its followers ran).
+	// Retry every op individually so ops that would have succeeded on their
+	// own still get a fair chance.
+	for _, op := range batch {
+		fn := op.fn
+		op.reply <- w.env.UpdateLocked(func(txn interface{}) error { return fn(txn.(*lmdb.Txn)) })
+	}
+}
+
+func (w *Writer) failAll(batch []*writeOp, err error) {
+	for _, op := range batch {
+		op.reply <- err
+	}
+}
+
+// ErrWriterClosed is returned to callers of Update whose op was still queued
+// when the Writer was Closed.
+var ErrWriterClosed = errWriterClosed("lmdbsync: writer closed")
+
+type errWriterClosed string
+
+func (e errWriterClosed) Error() string { return string(e) }
@@ -0,0 +1,76 @@
+package lmdbsync
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+func newTestWriterEnv(t *testing.T) *Env {
+	t.Helper()
+	env, err := NewEnv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.SetMapSize(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Open(t.TempDir(), 0, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { env.LMDBEnv().Close() })
+	return env
+}
+
+// TestWriterCloseConcurrentWithUpdate verifies that an Update racing with
+// Close returns ErrWriterClosed instead of blocking forever, regardless of
+// which goroutine the scheduler favors.
+func TestWriterCloseConcurrentWithUpdate(t *testing.T) {
+	env := newTestWriterEnv(t)
+	w := NewWriter(env)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 50)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = w.Update(func(txn *lmdb.Txn) error { return nil })
+		}(i)
+	}
+
+	w.Close()
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, ErrWriterClosed) {
+			t.Fatalf("Update[%d] = %v, want nil or ErrWriterClosed", i, err)
+		}
+	}
+}
+
+func TestWriterBatchesConcurrentUpdates(t *testing.T) {
+	env := newTestWriterEnv(t)
+	w := NewWriter(env)
+	defer w.Close()
+
+	var wg sync.WaitGroup
+	n := 20
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = w.Update(func(txn *lmdb.Txn) error { return nil })
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Update[%d]: %v", i, err)
+		}
+	}
+}